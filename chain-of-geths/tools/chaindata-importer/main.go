@@ -0,0 +1,400 @@
+// chaindata-importer loads an RLP block file (as written by `geth export`) into a
+// target chaindata directory by writing blocks, canonical hashes and total
+// difficulty directly with rawdb.
+//
+// It does not execute blocks: the target ends up with headers/bodies/TD for the
+// imported range but no state beyond whatever was already there (e.g. genesis
+// from `geth init`). Only the head header marker is advanced: the head
+// fast-block marker implies receipts and the head block marker implies state,
+// neither of which this tool writes.
+//
+// Configuration is via environment variables (mirroring the seed scripts):
+//
+//	DATADIR        target chaindata directory (required), e.g. /data/geth/chaindata
+//	ANCIENT        freezer directory (default: $DATADIR/ancient)
+//	IN_FILE        RLP block file to import (required); gzip/zstd input is detected
+//	PROGRESS_FILE  progress JSON (default: $IN_FILE.import.progress)
+//	CACHE_MB       database cache in MB (default: 512)
+//	HANDLES        database file handles (default: 512)
+//
+// The run is resumable: blocks already present in the target (same canonical hash
+// with a stored TD) are skipped, so an interrupted import can simply be re-run.
+// The progress file is informational; if it claims more than the target holds
+// (e.g. after a power loss), the missing blocks are re-imported.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/klauspost/compress/zstd"
+)
+
+// logEvery controls how often a progress line is printed to stderr.
+const logEvery = 10000
+
+// progress uses the same JSON shape as the export progress file written by
+// seed-v1.11.6-when-ready.sh.
+type progress struct {
+	LastDone  uint64  `json:"last_done"`
+	Phase     string  `json:"phase"`
+	UpdatedAt float64 `json:"updated_at"`
+	Note      string  `json:"note,omitempty"`
+}
+
+func envOr(key, def string) string {
+	if v := strings.TrimSpace(os.Getenv(key)); v != "" {
+		return v
+	}
+	return def
+}
+
+func envInt(key string, def int) int {
+	v := envOr(key, "")
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Fatalf("[import] invalid %s=%q: %v", key, v, err)
+	}
+	return n
+}
+
+// readProgress returns the last imported block number, or ok=false if there is
+// no usable progress file yet.
+func readProgress(path string) (lastDone uint64, ok bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Printf("[import] WARNING: cannot read progress file %s: %v", path, err)
+		}
+		return 0, false
+	}
+	var p progress
+	if err := json.Unmarshal(data, &p); err != nil {
+		log.Printf("[import] WARNING: ignoring malformed progress file %s: %v", path, err)
+		return 0, false
+	}
+	return p.LastDone, true
+}
+
+// writeProgress atomically replaces the progress file (tmp + rename), so a
+// crash never leaves a half-written JSON document behind.
+func writeProgress(path string, lastDone uint64, note string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(progress{
+		LastDone:  lastDone,
+		Phase:     "import",
+		UpdatedAt: float64(time.Now().UnixNano()) / 1e9,
+		Note:      note,
+	})
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// openInput opens the block file, transparently decompressing gzip or zstd
+// input. The format is sniffed from the leading magic bytes rather than the
+// file name, since a raw RLP block list never starts with either.
+func openInput(path string) (io.Reader, func() error, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	br := bufio.NewReaderSize(f, 1<<20)
+	// A short or empty file simply fails to match; the RLP decoder reports it.
+	magic, _ := br.Peek(len(zstdMagic))
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			f.Close()
+			return nil, nil, fmt.Errorf("gzip: %w", err)
+		}
+		return gz, func() error { gz.Close(); return f.Close() }, nil
+	case bytes.HasPrefix(magic, zstdMagic):
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			f.Close()
+			return nil, nil, fmt.Errorf("zstd: %w", err)
+		}
+		return zr, func() error { zr.Close(); return f.Close() }, nil
+	}
+	return br, f.Close, nil
+}
+
+// importer holds the state threaded through a single run.
+type importer struct {
+	db           ethdb.Database
+	batch        ethdb.Batch
+	progressPath string
+
+	headNumber uint64 // number of the head header currently in the target
+	hasHead    bool
+
+	prev        *types.Header // last block seen from the file (imported or skipped)
+	prevTd      *big.Int      // TD of prev, once known
+	pending     uint64        // highest block number sitting in the unflushed batch
+	pendingHash common.Hash   // hash of that block
+	hasPending  bool
+
+	imported    uint64
+	skipped     uint64
+	warnedAhead bool // progress file was found to be ahead of the target
+}
+
+// commit writes the current batch, advancing the head header marker if the
+// batch moves it forward.
+func (im *importer) commit() error {
+	if !im.hasPending {
+		return nil
+	}
+	if !im.hasHead || im.pending > im.headNumber {
+		rawdb.WriteHeadHeaderHash(im.batch, im.pendingHash)
+		im.headNumber, im.hasHead = im.pending, true
+	}
+	if err := im.batch.Write(); err != nil {
+		return fmt.Errorf("batch write at block %d: %w", im.pending, err)
+	}
+	im.batch.Reset()
+	im.hasPending = false
+	return nil
+}
+
+// flush commits the current batch and only then records its last block as
+// progress.
+func (im *importer) flush() error {
+	if !im.hasPending {
+		return nil
+	}
+	n := im.pending
+	if err := im.commit(); err != nil {
+		return err
+	}
+	if err := writeProgress(im.progressPath, n, ""); err != nil {
+		return fmt.Errorf("progress write: %w", err)
+	}
+	return nil
+}
+
+// finish commits any pending writes and records the last block seen in the
+// file, which may be a skipped block past the last imported one.
+func (im *importer) finish(note string) error {
+	if err := im.commit(); err != nil {
+		return err
+	}
+	if im.prev == nil {
+		return nil
+	}
+	if err := writeProgress(im.progressPath, im.prev.Number.Uint64(), note); err != nil {
+		return fmt.Errorf("progress write: %w", err)
+	}
+	return nil
+}
+
+// parentTd resolves the TD of the block's parent, either from the previous
+// block in this run or (at the start of a run) from the target database. TD is
+// never carried in the progress file, so a resumed run cannot double-count it.
+func (im *importer) parentTd(header *types.Header) (*big.Int, error) {
+	n := header.Number.Uint64()
+	if n == 0 {
+		return new(big.Int), nil
+	}
+	if im.prev != nil && im.prevTd != nil {
+		return im.prevTd, nil
+	}
+	td := rawdb.ReadTd(im.db, header.ParentHash, n-1)
+	if td == nil {
+		return nil, fmt.Errorf("block %d: parent %s has no stored TD in target (import must start at genesis or continue an existing chain)", n, header.ParentHash.Hex())
+	}
+	return td, nil
+}
+
+func (im *importer) process(block *types.Block, resumeTo uint64, resuming bool) error {
+	header := block.Header()
+	n := header.Number.Uint64()
+	hash := block.Hash()
+
+	if im.prev != nil {
+		if want := im.prev.Number.Uint64() + 1; n != want {
+			return fmt.Errorf("non-contiguous input: got block %d after %d", n, want-1)
+		}
+		if header.ParentHash != im.prev.Hash() {
+			return fmt.Errorf("block %d: parent hash %s does not match previous block %s", n, header.ParentHash.Hex(), im.prev.Hash().Hex())
+		}
+	}
+
+	// The target database, not the progress file, decides what is already
+	// imported: batch writes and the progress rename are not fsynced, so after a
+	// power loss the progress file may be ahead of what LevelDB kept.
+	existing := rawdb.ReadCanonicalHash(im.db, n)
+	if resuming && n <= resumeTo && existing == (common.Hash{}) && !im.warnedAhead {
+		log.Printf("[import] WARNING: progress file says last_done=%d but target has no block %d; re-importing from there", resumeTo, n)
+		im.warnedAhead = true
+	}
+	if existing != (common.Hash{}) && existing != hash {
+		return fmt.Errorf("block %d: target already has a different canonical block %s (file has %s)", n, existing.Hex(), hash.Hex())
+	}
+	if existing == hash {
+		if td := rawdb.ReadTd(im.db, hash, n); td != nil {
+			im.prev, im.prevTd = header, td
+			im.skipped++
+			return nil
+		}
+	}
+
+	ptd, err := im.parentTd(header)
+	if err != nil {
+		return err
+	}
+	td := new(big.Int).Add(ptd, header.Difficulty)
+
+	rawdb.WriteBlock(im.batch, block)
+	rawdb.WriteTd(im.batch, hash, n, td)
+	rawdb.WriteCanonicalHash(im.batch, hash, n)
+
+	im.prev, im.prevTd = header, td
+	im.pending, im.pendingHash, im.hasPending = n, hash, true
+	im.imported++
+
+	if im.batch.ValueSize() >= ethdb.IdealBatchSize {
+		return im.flush()
+	}
+	return nil
+}
+
+// errInterrupted is returned by run when SIGINT/SIGTERM stopped the import.
+var errInterrupted = errors.New("interrupted")
+
+// run streams inFile into db. It owns the input and signal handling; the
+// caller owns db, so it is closed on every exit path.
+func run(db ethdb.Database, inFile, progressPath string) error {
+	in, closeIn, err := openInput(inFile)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", inFile, err)
+	}
+	defer closeIn()
+
+	im := &importer{db: db, batch: db.NewBatch(), progressPath: progressPath}
+	if h := rawdb.ReadHeadHeaderHash(db); h != (common.Hash{}) {
+		if n := rawdb.ReadHeaderNumber(db, h); n != nil {
+			im.headNumber, im.hasHead = *n, true
+		}
+	}
+	resumeTo, resuming := readProgress(progressPath)
+	if resuming {
+		log.Printf("[import] resuming: progress file says last_done=%d", resumeTo)
+	}
+	log.Printf("[import] %s -> head header %d", inFile, im.headNumber)
+
+	// Stop cleanly on SIGINT/SIGTERM: flush what we have so progress stays accurate.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	start := time.Now()
+	stream := rlp.NewStream(in, 0)
+	for {
+		if ctx.Err() != nil {
+			if err := im.finish("interrupted"); err != nil {
+				return err
+			}
+			log.Printf("[import] interrupted; imported=%d skipped=%d", im.imported, im.skipped)
+			return errInterrupted
+		}
+		var block types.Block
+		if err := stream.Decode(&block); err != nil {
+			if err == io.EOF {
+				break
+			}
+			if im.prev != nil {
+				return fmt.Errorf("decode after block %d: %w", im.prev.Number.Uint64(), err)
+			}
+			return fmt.Errorf("decode first block: %w", err)
+		}
+		if err := im.process(&block, resumeTo, resuming); err != nil {
+			return err
+		}
+		if n := block.NumberU64(); n%logEvery == 0 {
+			log.Printf("[import] block=%d imported=%d skipped=%d elapsed=%s", n, im.imported, im.skipped, time.Since(start).Round(time.Second))
+		}
+	}
+	if im.prev == nil {
+		return fmt.Errorf("%s contains no blocks", inFile)
+	}
+	if err := im.finish("done"); err != nil {
+		return err
+	}
+	log.Printf("[import] done: last=%d imported=%d skipped=%d elapsed=%s", im.prev.Number.Uint64(), im.imported, im.skipped, time.Since(start).Round(time.Second))
+	return nil
+}
+
+func main() {
+	log.SetFlags(log.LstdFlags)
+
+	datadir := envOr("DATADIR", "")
+	inFile := envOr("IN_FILE", "")
+	if datadir == "" || inFile == "" {
+		log.Fatalf("[import] DATADIR and IN_FILE are required")
+	}
+	ancient := envOr("ANCIENT", filepath.Join(datadir, "ancient"))
+	progressPath := envOr("PROGRESS_FILE", inFile+".import.progress")
+	cache := envInt("CACHE_MB", 512)
+	handles := envInt("HANDLES", 512)
+
+	db, err := rawdb.Open(rawdb.OpenOptions{
+		Type:              "leveldb",
+		Directory:         datadir,
+		AncientsDirectory: ancient,
+		Namespace:         "chaindata-importer/",
+		Cache:             cache,
+		Handles:           handles,
+	})
+	if err != nil {
+		log.Fatalf("[import] open %s (ancient %s): %v", datadir, ancient, err)
+	}
+	log.Printf("[import] target %s (ancient %s)", datadir, ancient)
+
+	err = run(db, inFile, progressPath)
+	if cerr := db.Close(); cerr != nil {
+		log.Printf("[import] WARNING: closing database: %v", cerr)
+	}
+	switch {
+	case errors.Is(err, errInterrupted):
+		os.Exit(130)
+	case err != nil:
+		log.Fatalf("[import] %v", err)
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/klauspost/compress/zstd"
+)
+
+// makeChain builds blocks 0..n-1. All chains share the same genesis; tag is
+// mixed into the extra-data of later blocks so different tags fork at block 1.
+func makeChain(n int, tag string) []*types.Block {
+	blocks := make([]*types.Block, 0, n)
+	var parent common.Hash
+	for i := 0; i < n; i++ {
+		extra := []byte{}
+		if i > 0 {
+			extra = []byte(tag)
+		}
+		header := &types.Header{
+			ParentHash: parent,
+			Number:     big.NewInt(int64(i)),
+			Difficulty: big.NewInt(131072 + int64(i)*1000),
+			GasLimit:   5000,
+			Time:       uint64(i) * 15,
+			Extra:      extra,
+		}
+		b := types.NewBlockWithHeader(header)
+		blocks = append(blocks, b)
+		parent = b.Hash()
+	}
+	return blocks
+}
+
+func writeBlocks(t *testing.T, path, compress string, blocks []*types.Block) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var w io.Writer = f
+	var closeW func() error
+	switch compress {
+	case "gzip":
+		gz := gzip.NewWriter(f)
+		w, closeW = gz, gz.Close
+	case "zstd":
+		zw, err := zstd.NewWriter(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w, closeW = zw, zw.Close
+	}
+	for _, b := range blocks {
+		if err := rlp.Encode(w, b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if closeW != nil {
+		if err := closeW(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func importBlocks(t *testing.T, db ethdb.Database, dir, name, compress string, blocks []*types.Block) error {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	writeBlocks(t, path, compress, blocks)
+	return run(db, path, filepath.Join(dir, "progress.json"))
+}
+
+func checkImported(t *testing.T, db ethdb.Database, blocks []*types.Block) {
+	t.Helper()
+	td := new(big.Int)
+	for _, b := range blocks {
+		n := b.NumberU64()
+		td.Add(td, b.Difficulty())
+		if got := rawdb.ReadCanonicalHash(db, n); got != b.Hash() {
+			t.Fatalf("block %d: canonical hash %x, want %x", n, got, b.Hash())
+		}
+		if got := rawdb.ReadTd(db, b.Hash(), n); got == nil || got.Cmp(td) != 0 {
+			t.Fatalf("block %d: td %v, want %v", n, got, td)
+		}
+		if rawdb.ReadBody(db, b.Hash(), n) == nil {
+			t.Fatalf("block %d: body missing", n)
+		}
+	}
+}
+
+func checkHead(t *testing.T, db ethdb.Database, want *types.Block) {
+	t.Helper()
+	if got := rawdb.ReadHeadHeaderHash(db); got != want.Hash() {
+		t.Fatalf("head header %x, want block %d (%x)", got, want.NumberU64(), want.Hash())
+	}
+	if got := rawdb.ReadHeadFastBlockHash(db); got != (common.Hash{}) {
+		t.Fatalf("head fast block was written: %x", got)
+	}
+}
+
+func checkProgress(t *testing.T, dir string, want uint64) {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, "progress.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p progress
+	if err := json.Unmarshal(data, &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.LastDone != want || p.Phase != "import" || p.Note != "done" {
+		t.Fatalf("progress %+v, want last_done=%d phase=import note=done", p, want)
+	}
+}
+
+func TestRun(t *testing.T) {
+	chain := makeChain(10, "a")
+	fork := makeChain(10, "b")
+	last := chain[len(chain)-1]
+
+	tests := []struct {
+		name     string
+		setup    func(t *testing.T, db ethdb.Database, dir string)
+		compress string
+		input    []*types.Block
+		wantErr  string
+		check    func(t *testing.T, db ethdb.Database, dir string)
+	}{
+		{
+			name:  "fresh import",
+			input: chain,
+			check: func(t *testing.T, db ethdb.Database, dir string) {
+				checkImported(t, db, chain)
+				checkHead(t, db, last)
+				checkProgress(t, dir, last.NumberU64())
+			},
+		},
+		{
+			name: "re-run skips and keeps head",
+			setup: func(t *testing.T, db ethdb.Database, dir string) {
+				if err := importBlocks(t, db, dir, "full.rlp", "", chain); err != nil {
+					t.Fatal(err)
+				}
+			},
+			input: chain[:5],
+			check: func(t *testing.T, db ethdb.Database, dir string) {
+				checkImported(t, db, chain)
+				checkHead(t, db, last)
+				checkProgress(t, dir, 4)
+			},
+		},
+		{
+			name: "progress ahead of db re-imports",
+			setup: func(t *testing.T, db ethdb.Database, dir string) {
+				if err := importBlocks(t, db, dir, "first.rlp", "", chain[:5]); err != nil {
+					t.Fatal(err)
+				}
+				if err := writeProgress(filepath.Join(dir, "progress.json"), 8, ""); err != nil {
+					t.Fatal(err)
+				}
+			},
+			input: chain,
+			check: func(t *testing.T, db ethdb.Database, dir string) {
+				checkImported(t, db, chain)
+				checkHead(t, db, last)
+				checkProgress(t, dir, last.NumberU64())
+			},
+		},
+		{
+			name: "different canonical block",
+			setup: func(t *testing.T, db ethdb.Database, dir string) {
+				if err := importBlocks(t, db, dir, "a.rlp", "", chain); err != nil {
+					t.Fatal(err)
+				}
+			},
+			input:   fork,
+			wantErr: "block 1: target already has a different canonical block",
+		},
+		{
+			name:    "gap in input",
+			input:   append(append([]*types.Block{}, chain[:3]...), chain[4:]...),
+			wantErr: "non-contiguous input: got block 4 after 2",
+		},
+		{
+			name:    "parent mismatch",
+			input:   append(append([]*types.Block{}, chain[:3]...), fork[3:]...),
+			wantErr: "block 3: parent hash",
+		},
+		{
+			name:    "empty input",
+			input:   nil,
+			wantErr: "contains no blocks",
+		},
+		{
+			name:     "gzip input",
+			compress: "gzip",
+			input:    chain,
+			check: func(t *testing.T, db ethdb.Database, dir string) {
+				checkImported(t, db, chain)
+				checkHead(t, db, last)
+			},
+		},
+		{
+			name:     "zstd input",
+			compress: "zstd",
+			input:    chain,
+			check: func(t *testing.T, db ethdb.Database, dir string) {
+				checkImported(t, db, chain)
+				checkHead(t, db, last)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := rawdb.NewMemoryDatabase()
+			defer db.Close()
+			dir := t.TempDir()
+			if tt.setup != nil {
+				tt.setup(t, db, dir)
+			}
+			// The name deliberately has no extension: compression is sniffed.
+			err := importBlocks(t, db, dir, "input", tt.compress, tt.input)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.check(t, db, dir)
+		})
+	}
+}